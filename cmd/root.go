@@ -1,31 +1,44 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"sort"
+	"syscall"
 	"time"
 
 	"github.com/21state/celestia-snapshot-finder/internal/config"
 	"github.com/21state/celestia-snapshot-finder/internal/downloader"
+	"github.com/21state/celestia-snapshot-finder/internal/integrity"
 	"github.com/21state/celestia-snapshot-finder/internal/provider"
+	"github.com/21state/celestia-snapshot-finder/internal/retry"
 	"github.com/21state/celestia-snapshot-finder/internal/speedtest"
 	"github.com/21state/celestia-snapshot-finder/internal/version"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
-	"gopkg.in/yaml.v3"
 )
 
-const providersURL = "https://raw.githubusercontent.com/21state/celestia-snapshots/refs/heads/main/providers.yaml"
+const defaultProvidersURL = "https://raw.githubusercontent.com/21state/celestia-snapshots/refs/heads/main/providers.yaml"
 
 var (
-	chainID  string
-	manual   bool
-	debug    bool
-	rootCmd  = &cobra.Command{
+	chainID             string
+	manual              bool
+	debug               bool
+	skipVerify          bool
+	retryMax            int
+	retryBase           time.Duration
+	retryMaxDelay       time.Duration
+	simulateFailureRate float64
+	timeout             time.Duration
+	providersFile       string
+	providersURL        string
+	rootCmd             = &cobra.Command{
 		Use:   "celestia-snapshot-finder [node-type] [snapshot-type]",
 		Short: "Download Celestia node snapshots",
 		Long: `A CLI tool for downloading Celestia node snapshots with direct URLs.
@@ -40,6 +53,15 @@ func init() {
 	rootCmd.PersistentFlags().StringVarP(&chainID, "chain-id", "n", "celestia", "Chain ID")
 	rootCmd.PersistentFlags().BoolVarP(&manual, "manual", "m", false, "Enable manual selection")
 	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "Enable debug mode with extra information")
+	rootCmd.PersistentFlags().BoolVar(&skipVerify, "skip-verify", false, "Skip snapshot integrity verification")
+	rootCmd.PersistentFlags().IntVar(&retryMax, "retry-max", 3, "Maximum number of retries for failed requests")
+	rootCmd.PersistentFlags().DurationVar(&retryBase, "retry-base", 500*time.Millisecond, "Base delay before the first retry")
+	rootCmd.PersistentFlags().DurationVar(&retryMaxDelay, "retry-max-delay", 10*time.Second, "Maximum delay between retries")
+	rootCmd.PersistentFlags().Float64Var(&simulateFailureRate, "simulate-failure-rate", 0, "Fraction (0-1) of requests to fail, for exercising the retry path")
+	rootCmd.PersistentFlags().MarkHidden("simulate-failure-rate")
+	rootCmd.PersistentFlags().DurationVar(&timeout, "timeout", 0, "Abort the run if it takes longer than this (0 = no timeout)")
+	rootCmd.PersistentFlags().StringVar(&providersFile, "providers-file", "", "Load providers from a local YAML file instead of fetching them")
+	rootCmd.PersistentFlags().StringVar(&providersURL, "providers-url", defaultProvidersURL, "URL to fetch the providers list from")
 }
 
 func debugPrint(format string, a ...interface{}) {
@@ -59,21 +81,124 @@ func Execute() error {
 	return rootCmd.Execute()
 }
 
-func fetchProviders() (*config.Config, error) {
+func retryPolicy() retry.Policy {
+	return retry.Policy{
+		MaxRetries: retryMax,
+		BaseDelay:  retryBase,
+		MaxDelay:   retryMaxDelay,
+	}
+}
+
+func failureInjector() retry.FailureInjector {
+	if simulateFailureRate <= 0 {
+		return nil
+	}
+	return &retry.RateInjector{FailRate: simulateFailureRate}
+}
+
+// providersCacheMeta is the sidecar persisted next to the cached providers
+// document so the next run can make a conditional request against it.
+type providersCacheMeta struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// providersCacheDir returns ~/.cache/celestia-snapshot-finder (or the
+// platform equivalent), creating it if necessary.
+func providersCacheDir() (string, error) {
+	cacheHome, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(cacheHome, "celestia-snapshot-finder")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// loadProviders resolves the providers document from, in order: a local
+// --providers-file, or the upstream --providers-url backed by an on-disk
+// cache that's used whenever the network is unreachable. Either way, any
+// fragments under providers.d/ in the cache directory are merged in
+// afterwards so operators can pin private mirrors.
+func loadProviders(ctx context.Context, client *retry.Client) (*config.Config, error) {
+	var cfg *config.Config
+
+	if providersFile != "" {
+		debugPrint("Loading providers from local file %s", providersFile)
+		loaded, err := config.LoadFile(providersFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load providers file: %w", err)
+		}
+		cfg = loaded
+	} else {
+		loaded, err := fetchProvidersCached(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+		cfg = loaded
+	}
+
+	cacheDir, err := providersCacheDir()
+	if err != nil {
+		debugPrint("Providers cache directory unavailable, skipping providers.d: %v", err)
+		return cfg, nil
+	}
+
+	providersDDir := filepath.Join(cacheDir, "providers.d")
+	if err := cfg.MergeDir(providersDDir); err != nil {
+		return nil, fmt.Errorf("failed to merge %s: %w", providersDDir, err)
+	}
+
+	return cfg, nil
+}
+
+// fetchProvidersCached fetches providersURL, validating the cached copy
+// with If-None-Match/If-Modified-Since, and falls back to that cache on
+// any network failure.
+func fetchProvidersCached(ctx context.Context, client *retry.Client) (*config.Config, error) {
 	debugPrint("Fetching providers from %s", providersURL)
-	
-	client := &http.Client{
-		Timeout: 10 * time.Second,
+
+	cacheDir, cacheErr := providersCacheDir()
+	var cachePath, metaPath string
+	var meta providersCacheMeta
+	if cacheErr != nil {
+		debugPrint("Providers cache directory unavailable: %v", cacheErr)
+	} else {
+		cachePath = filepath.Join(cacheDir, "providers.yaml")
+		metaPath = cachePath + ".meta"
+		if data, err := os.ReadFile(metaPath); err == nil {
+			json.Unmarshal(data, &meta)
+		}
 	}
-	
-	resp, err := client.Get(providersURL)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, providersURL, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch providers: %w", err)
+		return nil, fmt.Errorf("failed to build providers request: %w", err)
+	}
+	if meta.ETag != "" {
+		req.Header.Set("If-None-Match", meta.ETag)
+	}
+	if meta.LastModified != "" {
+		req.Header.Set("If-Modified-Since", meta.LastModified)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		debugPrint("Providers fetch failed, falling back to cache: %v", err)
+		return loadCachedProviders(cachePath, err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified {
+		debugPrint("Providers unchanged since last fetch, using cached copy")
+		return loadCachedProviders(cachePath, fmt.Errorf("server reported no changes"))
+	}
+
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to fetch providers: HTTP %d", resp.StatusCode)
+		debugPrint("Providers fetch returned HTTP %d, falling back to cache", resp.StatusCode)
+		return loadCachedProviders(cachePath, fmt.Errorf("HTTP %d", resp.StatusCode))
 	}
 
 	data, err := io.ReadAll(resp.Body)
@@ -81,20 +206,46 @@ func fetchProviders() (*config.Config, error) {
 		return nil, fmt.Errorf("failed to read providers data: %w", err)
 	}
 
-	var cfg config.Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("failed to parse providers data: %w", err)
+	cfg, err := config.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if cachePath != "" {
+		if err := os.WriteFile(cachePath, data, 0644); err != nil {
+			debugPrint("Failed to write providers cache: %v", err)
+		} else {
+			newMeta := providersCacheMeta{
+				ETag:         resp.Header.Get("ETag"),
+				LastModified: resp.Header.Get("Last-Modified"),
+			}
+			if metaData, err := json.Marshal(newMeta); err == nil {
+				os.WriteFile(metaPath, metaData, 0644)
+			}
+		}
 	}
 
 	debugPrint("Successfully fetched providers configuration")
-	return &cfg, nil
+	return cfg, nil
+}
+
+func loadCachedProviders(cachePath string, cause error) (*config.Config, error) {
+	if cachePath == "" {
+		return nil, fmt.Errorf("failed to fetch providers and no cache available: %w", cause)
+	}
+	cfg, err := config.LoadFile(cachePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch providers (%v) and failed to load cache: %w", cause, err)
+	}
+	debugPrint("Loaded providers from cache at %s", cachePath)
+	return cfg, nil
 }
 
 func runRoot(cmd *cobra.Command, args []string) error {
 	nodeType := args[0]
 	snapshotType := args[1]
 
-	debugPrint("Starting with raw arguments: nodeType=%s, snapshotType=%s, chainID=%s, manual=%v", 
+	debugPrint("Starting with raw arguments: nodeType=%s, snapshotType=%s, chainID=%s, manual=%v",
 		nodeType, snapshotType, chainID, manual)
 
 	nodeType, snapshotType, err := validateArgs(nodeType, snapshotType)
@@ -102,10 +253,37 @@ func runRoot(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("validation failed: %w", err)
 	}
 
-	printInfo("Searching for %s-%s snapshots [chain-id: %s, mode: %s]", 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if timeout > 0 {
+		var timeoutCancel context.CancelFunc
+		ctx, timeoutCancel = context.WithTimeout(ctx, timeout)
+		defer timeoutCancel()
+	}
+
+	startTime := time.Now()
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	go func() {
+		<-sigCh
+		printInfo("Stopping after %s — partial downloads are checkpointed, rerun the same command to resume (press Ctrl+C again to force quit)", time.Since(startTime).Round(time.Second))
+		cancel()
+		<-sigCh
+		fmt.Println("\nForced exit.")
+		os.Exit(1)
+	}()
+
+	printInfo("Searching for %s-%s snapshots [chain-id: %s, mode: %s]",
 		nodeType, snapshotType, chainID, map[bool]string{true: "manual", false: "auto"}[manual])
 
-	cfg, err := fetchProviders()
+	policy := retryPolicy()
+	injector := failureInjector()
+
+	providersClient := retry.NewClient(&http.Client{Timeout: 10 * time.Second}, policy, injector, debugPrint)
+	cfg, err := loadProviders(ctx, providersClient)
 	if err != nil {
 		return fmt.Errorf("failed to load providers configuration: %w", err)
 	}
@@ -122,9 +300,9 @@ func runRoot(cmd *cobra.Command, args []string) error {
 	}
 
 	debugPrint("Initializing managers")
-	providerMgr := provider.NewManager(cfg.Providers, debugPrint)
-	speedTester := speedtest.NewSpeedTester(debugPrint)
-	downloadMgr := downloader.NewManager()
+	providerMgr := provider.NewManager(cfg.Providers, debugPrint, policy, injector)
+	speedTester := speedtest.NewSpeedTester(debugPrint, policy, injector)
+	downloadMgr := downloader.NewManager(policy, injector, debugPrint)
 
 	debugPrint("Filtering snapshots for type=%s-%s and chainID=%s", nodeType, snapshotType, chainID)
 	providers := providerMgr.FilterProviders(nodeType, snapshotType, chainID)
@@ -141,7 +319,7 @@ func runRoot(cmd *cobra.Command, args []string) error {
 	}
 
 	debugPrint("Running health checks on snapshots")
-	providers = providerMgr.CheckHealth(providers)
+	providers = providerMgr.CheckHealth(ctx, providers)
 	if len(providers) == 0 {
 		return fmt.Errorf("no healthy snapshots found")
 	}
@@ -156,7 +334,7 @@ func runRoot(cmd *cobra.Command, args []string) error {
 
 	printInfo("Testing download speeds...")
 	debugPrint("Starting speed tests")
-	providers = speedTester.TestProviders(providers)
+	providers = speedTester.TestProviders(ctx, providers)
 
 	sort.Slice(providers, func(i, j int) bool {
 		return providers[i].Speed > providers[j].Speed
@@ -201,21 +379,55 @@ func runRoot(cmd *cobra.Command, args []string) error {
 	downloadDir := filepath.Join(homeDir, "celestia-snapshots")
 	debugPrint("Download directory: %s", downloadDir)
 
-	printInfo("Starting download from %s", selectedProvider.Name)
-	debugPrint("Starting download from URL: %s", selectedProvider.URL)
-	result, err := downloadMgr.Download(selectedProvider.URL, downloadDir)
+	verifier := integrity.NewVerifier(debugPrint)
+	var partHashes []integrity.PartHash
+	if !skipVerify && selectedProvider.MetadataURL != "" {
+		if meta, err := verifier.FetchMetadata(selectedProvider.MetadataURL); err != nil {
+			debugPrint("Failed to pre-fetch snapshot metadata, early-abort verification disabled: %v", err)
+		} else {
+			partHashes = meta.Parts
+		}
+	}
+
+	var result *downloader.DownloadResult
+	if !manual && len(providers) > 1 {
+		printInfo("Starting load-balanced download across %d mirrors", len(providers))
+		debugPrint("Mirrors: %v", providers)
+		multiOpts := downloader.DefaultMultiOpts()
+		multiOpts.PartHashes = partHashes
+		result, err = downloadMgr.DownloadMulti(ctx, providers, downloadDir, multiOpts)
+	} else {
+		printInfo("Starting download from %s", selectedProvider.Name)
+		debugPrint("Starting download from URL: %s", selectedProvider.URL)
+		result, err = downloadMgr.Download(ctx, selectedProvider.URL, downloadDir, downloader.DefaultOptions())
+	}
 	if err != nil {
 		debugPrint("Download failed: %v", err)
+		if ctx.Err() != nil {
+			return fmt.Errorf("download interrupted after %s: %w", time.Since(startTime).Round(time.Second), ctx.Err())
+		}
 		return fmt.Errorf("failed to download snapshot: %w", err)
 	}
 
+	if !skipVerify && selectedProvider.MetadataURL != "" {
+		printInfo("Verifying snapshot integrity")
+		algo, err := verifier.VerifyDownload(result.Path, selectedProvider.MetadataURL)
+		if err != nil {
+			debugPrint("Verification failed: %v", err)
+			return fmt.Errorf("snapshot integrity verification failed: %w", err)
+		}
+		printInfo("Snapshot integrity verified (%s)", algo)
+	} else if !skipVerify {
+		debugPrint("No metadata URL available, skipping integrity verification")
+	}
+
 	success := color.New(color.FgGreen).SprintFunc()
 	fmt.Printf("\n%s Download completed!\n", success("âœ“"))
 	fmt.Printf("Snapshot saved to: %s\n", result.Path)
-	
+
 	sizeGB := float64(result.Size) / 1000 / 1000 / 1000
 	fmt.Printf("Size: %.2f GB\n", sizeGB)
-	debugPrint("Download completed successfully. File size: %d bytes (%.2f GB)", 
+	debugPrint("Download completed successfully. File size: %d bytes (%.2f GB)",
 		result.Size, sizeGB)
 
 	return nil
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Parse unmarshals a providers document and validates its schema_version.
+func Parse(data []byte) (*Config, error) {
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse providers data: %w", err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// Validate rejects documents from a schema this binary doesn't understand,
+// so a future breaking change to the YAML surface fails loudly instead of
+// silently mis-parsing into an empty provider list.
+func (c *Config) Validate() error {
+	if c.SchemaVersion == 0 {
+		c.SchemaVersion = CurrentSchemaVersion
+		return nil
+	}
+	if c.SchemaVersion != CurrentSchemaVersion {
+		return fmt.Errorf("unsupported providers schema_version %d (this binary supports %d)", c.SchemaVersion, CurrentSchemaVersion)
+	}
+	return nil
+}
+
+// LoadFile reads and parses a providers document from a local path.
+func LoadFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return Parse(data)
+}
+
+// Merge appends other's providers onto c.
+func (c *Config) Merge(other *Config) {
+	c.Providers = append(c.Providers, other.Providers...)
+}
+
+// MergeDir merges every *.yaml/*.yml file in dir into c, in sorted order,
+// so operators can drop in pinned private mirrors alongside the base
+// provider list. A missing directory is not an error.
+func (c *Config) MergeDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		ext := filepath.Ext(e.Name())
+		if ext == ".yaml" || ext == ".yml" {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		fragment, err := LoadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to load %s: %w", path, err)
+		}
+		c.Merge(fragment)
+	}
+
+	return nil
+}
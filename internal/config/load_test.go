@@ -0,0 +1,84 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         Config
+		wantErr     bool
+		wantVersion int
+	}{
+		{"missing schema version defaults to current", Config{}, false, CurrentSchemaVersion},
+		{"matching schema version", Config{SchemaVersion: CurrentSchemaVersion}, false, CurrentSchemaVersion},
+		{"unsupported schema version", Config{SchemaVersion: CurrentSchemaVersion + 1}, true, CurrentSchemaVersion + 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if cfg.SchemaVersion != tt.wantVersion {
+				t.Fatalf("SchemaVersion = %d, want %d", cfg.SchemaVersion, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func writeYAML(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfigMergeDir(t *testing.T) {
+	t.Run("missing directory is not an error", func(t *testing.T) {
+		cfg := &Config{}
+		if err := cfg.MergeDir(filepath.Join(t.TempDir(), "does-not-exist")); err != nil {
+			t.Fatalf("MergeDir() error = %v, want nil", err)
+		}
+		if len(cfg.Providers) != 0 {
+			t.Fatalf("Providers = %v, want empty", cfg.Providers)
+		}
+	})
+
+	t.Run("merges fragments in sorted filename order", func(t *testing.T) {
+		dir := t.TempDir()
+		writeYAML(t, filepath.Join(dir, "b.yaml"), "providers:\n  - name: b-provider\n    snapshots: []\n")
+		writeYAML(t, filepath.Join(dir, "a.yml"), "providers:\n  - name: a-provider\n    snapshots: []\n")
+		writeYAML(t, filepath.Join(dir, "ignored.txt"), "not yaml")
+
+		cfg := &Config{Providers: []Provider{{Name: "base-provider"}}}
+		if err := cfg.MergeDir(dir); err != nil {
+			t.Fatalf("MergeDir() error = %v, want nil", err)
+		}
+
+		want := []string{"base-provider", "a-provider", "b-provider"}
+		if len(cfg.Providers) != len(want) {
+			t.Fatalf("Providers = %v, want %d entries", cfg.Providers, len(want))
+		}
+		for i, name := range want {
+			if cfg.Providers[i].Name != name {
+				t.Fatalf("Providers[%d].Name = %q, want %q", i, cfg.Providers[i].Name, name)
+			}
+		}
+	})
+
+	t.Run("invalid fragment returns an error", func(t *testing.T) {
+		dir := t.TempDir()
+		writeYAML(t, filepath.Join(dir, "bad.yaml"), "schema_version: 999\nproviders: []\n")
+
+		cfg := &Config{}
+		if err := cfg.MergeDir(dir); err == nil {
+			t.Fatal("MergeDir() error = nil, want non-nil")
+		}
+	})
+}
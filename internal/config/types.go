@@ -1,7 +1,13 @@
 package config
 
+// CurrentSchemaVersion is the highest providers.yaml schema this binary
+// understands. Documents that omit schema_version are treated as version 1
+// for backward compatibility with existing provider lists.
+const CurrentSchemaVersion = 1
+
 type Config struct {
-	Providers []Provider `yaml:"providers"`
+	SchemaVersion int        `yaml:"schema_version,omitempty"`
+	Providers     []Provider `yaml:"providers"`
 }
 
 type Provider struct {
@@ -1,53 +1,122 @@
 package downloader
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/21state/celestia-snapshot-finder/internal/integrity"
+	"github.com/21state/celestia-snapshot-finder/internal/provider"
+	"github.com/21state/celestia-snapshot-finder/internal/retry"
 	"github.com/schollz/progressbar/v3"
 )
 
+const (
+	partSuffix = ".part"
+	metaSuffix = ".meta"
+)
+
+type DebugLogger func(format string, a ...interface{})
+
 type Manager struct {
-	client *http.Client
+	client *retry.Client
+	policy retry.Policy
 }
 
-func NewManager() *Manager {
+func NewManager(retryPolicy retry.Policy, injector retry.FailureInjector, debugLog DebugLogger) *Manager {
+	var logFn func(string, ...interface{})
+	if debugLog != nil {
+		logFn = func(format string, a ...interface{}) { debugLog(format, a...) }
+	}
 	return &Manager{
-		client: &http.Client{
+		client: retry.NewClient(&http.Client{
 			Timeout: 0,
-		},
+		}, retryPolicy, injector, logFn),
+		policy: retryPolicy,
 	}
 }
 
+// Options controls how Download behaves.
+type Options struct {
+	// Resume, when true, continues a previously interrupted download
+	// from its ".part" file instead of starting over.
+	Resume bool
+}
+
+// DefaultOptions returns the options used when the caller has no special
+// requirements: resume is enabled.
+func DefaultOptions() Options {
+	return Options{Resume: true}
+}
+
 type DownloadResult struct {
 	Path string
 	Size int64
 }
 
-func (m *Manager) Download(url, destDir string) (*DownloadResult, error) {
+// resumeMeta is the sidecar persisted alongside a ".part" file so a later
+// run can tell whether the partial data still matches the remote file.
+type resumeMeta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Size         int64  `json:"size"`
+}
+
+func (m *Manager) Download(ctx context.Context, url, destDir string, opts Options) (*DownloadResult, error) {
 	if err := os.MkdirAll(destDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create destination directory: %w", err)
 	}
 
-	resp, err := m.client.Head(url)
+	headReq, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get file info: %w", err)
+		return nil, fmt.Errorf("failed to build head request: %w", err)
 	}
-	fileSize := resp.ContentLength
-
-	resp, err = m.client.Get(url)
+	headResp, err := m.client.Do(headReq)
 	if err != nil {
-		return nil, fmt.Errorf("failed to start download: %w", err)
+		return nil, fmt.Errorf("failed to get file info: %w", err)
 	}
-	defer resp.Body.Close()
+	headResp.Body.Close()
+	fileSize := headResp.ContentLength
 
 	fileName := filepath.Base(url)
 	destPath := filepath.Join(destDir, fileName)
-	file, err := os.Create(destPath)
+	partPath := destPath + partSuffix
+	metaPath := partPath + metaSuffix
+
+	meta := resumeMeta{
+		URL:          url,
+		ETag:         headResp.Header.Get("ETag"),
+		LastModified: headResp.Header.Get("Last-Modified"),
+		Size:         fileSize,
+	}
+
+	var resumeFrom int64
+	if opts.Resume {
+		resumeFrom = resumeOffset(partPath, metaPath, meta)
+	}
+	if resumeFrom == 0 {
+		os.Remove(partPath)
+		os.Remove(metaPath)
+	}
+
+	if data, err := json.Marshal(meta); err == nil {
+		os.WriteFile(metaPath, data, 0644)
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY
+	if resumeFrom == 0 {
+		flags |= os.O_TRUNC
+	}
+
+	file, err := os.OpenFile(partPath, flags, 0644)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create file: %w", err)
 	}
@@ -65,14 +134,602 @@ func (m *Manager) Download(url, destDir string) (*DownloadResult, error) {
 		}),
 		progressbar.OptionUseIECUnits(false),
 	)
+	if resumeFrom > 0 {
+		bar.Add64(resumeFrom)
+	}
 
-	_, err = io.Copy(io.MultiWriter(file, bar), resp.Body)
-	if err != nil {
+	w := &offsetWriter{file: file, bar: bar, off: resumeFrom}
+	if err := m.copyBody(ctx, url, w, meta); err != nil {
 		return nil, fmt.Errorf("download failed: %w", err)
 	}
 
+	if err := file.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finalize file: %w", err)
+	}
+
+	if err := os.Rename(partPath, destPath); err != nil {
+		return nil, fmt.Errorf("failed to finalize download: %w", err)
+	}
+	os.Remove(metaPath)
+
 	return &DownloadResult{
 		Path: destPath,
 		Size: fileSize,
 	}, nil
 }
+
+// resumeOffset returns the byte offset to resume from, or 0 if no usable
+// partial download exists (missing, corrupt, or for a different remote file).
+func resumeOffset(partPath, metaPath string, want resumeMeta) int64 {
+	info, err := os.Stat(partPath)
+	if err != nil || info.Size() == 0 {
+		return 0
+	}
+
+	data, err := os.ReadFile(metaPath)
+	if err != nil {
+		return 0
+	}
+
+	var have resumeMeta
+	if err := json.Unmarshal(data, &have); err != nil {
+		return 0
+	}
+
+	if have.URL != want.URL || have.Size != want.Size {
+		return 0
+	}
+	if want.ETag != "" && have.ETag != want.ETag {
+		return 0
+	}
+	if want.LastModified != "" && have.LastModified != want.LastModified {
+		return 0
+	}
+
+	return info.Size()
+}
+
+// parseContentRangeTotal extracts the total size from a "bytes start-end/total" header.
+func parseContentRangeTotal(contentRange string) (int64, bool) {
+	var start, end, total int64
+	n, err := fmt.Sscanf(contentRange, "bytes %d-%d/%d", &start, &end, &total)
+	if err != nil || n != 3 {
+		return 0, false
+	}
+	return total, true
+}
+
+// copyBody streams url's body into w starting at w.off, requesting a Range
+// from there on. A connection dropped mid-stream (io.ErrUnexpectedEOF, a
+// net.Error) is retried by re-requesting from the offset already written
+// instead of restarting the whole download, up to m.policy.MaxRetries times.
+func (m *Manager) copyBody(ctx context.Context, url string, w *offsetWriter, meta resumeMeta) error {
+	var lastErr error
+	for attempt := 0; attempt <= m.policy.MaxRetries; attempt++ {
+		if attempt > 0 {
+			if err := retry.Sleep(ctx, retry.Backoff(m.policy, attempt)); err != nil {
+				return err
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		if w.off > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", w.off))
+		}
+
+		resp, err := m.client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if w.off > 0 && resp.StatusCode == http.StatusOK {
+			// Server ignored the Range request; restart from scratch
+			// without burning a retry attempt. Undo whatever this download
+			// already credited to the bar (the initial resume offset plus
+			// any bytes written since), or the fresh copy below double-
+			// counts them.
+			resp.Body.Close()
+			w.bar.Add(-int(w.off))
+			if err := w.file.Truncate(0); err != nil {
+				return fmt.Errorf("failed to restart download: %w", err)
+			}
+			w.off = 0
+			attempt--
+			continue
+		}
+		if w.off > 0 {
+			if resp.StatusCode != http.StatusPartialContent {
+				resp.Body.Close()
+				return fmt.Errorf("mirror returned unexpected status %d for resumed download", resp.StatusCode)
+			}
+			if total, ok := parseContentRangeTotal(resp.Header.Get("Content-Range")); !ok || total != meta.Size {
+				resp.Body.Close()
+				return fmt.Errorf("remote file changed since last resume attempt, restart the download")
+			}
+		}
+
+		_, copyErr := io.Copy(w, resp.Body)
+		resp.Body.Close()
+		if copyErr == nil {
+			return nil
+		}
+		if !retry.IsRetryableError(copyErr) {
+			return copyErr
+		}
+		lastErr = copyErr
+	}
+	return fmt.Errorf("exceeded %d retries: %w", m.policy.MaxRetries, lastErr)
+}
+
+// MultiOpts controls DownloadMulti.
+type MultiOpts struct {
+	// Parts is the number of byte ranges the file is split into.
+	Parts int
+	// PerConnection caps how many ranges are fetched concurrently from a
+	// single mirror.
+	PerConnection int
+	// PartHashes, when set, both defines the byte ranges to fetch (in
+	// place of Parts) and lets each one be verified against its expected
+	// sha256 as soon as it lands, so a corrupt range is requeued right away
+	// instead of only being caught once the whole file has finished
+	// downloading. The requeued range goes back on the shared queue; the
+	// next worker to pick it up may be on the same mirror.
+	PartHashes []integrity.PartHash
+}
+
+// DefaultMultiOpts returns sensible defaults for splitting a download
+// across a handful of mirrors.
+func DefaultMultiOpts() MultiOpts {
+	return MultiOpts{Parts: 4, PerConnection: 2}
+}
+
+// multiResumeMeta is the sidecar persisted alongside a multi-part ".part"
+// file so a later run can tell which ranges were already written and
+// whether the partial data still matches the remote file.
+type multiResumeMeta struct {
+	URL       string      `json:"url"`
+	ETag      string      `json:"etag,omitempty"`
+	Size      int64       `json:"size"`
+	Completed []rangeSpan `json:"completed,omitempty"`
+}
+
+// rangeSpan identifies a rangeJob by its byte bounds, for recording which
+// ranges have already landed.
+type rangeSpan struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"` // inclusive
+}
+
+// loadMultiResume returns the completed ranges recorded in metaPath, or nil
+// if there's nothing usable: a missing ".part"/".meta", a corrupt sidecar,
+// or one that no longer matches the remote file being downloaded.
+func loadMultiResume(partPath, metaPath string, want multiResumeMeta) []rangeSpan {
+	if _, err := os.Stat(partPath); err != nil {
+		return nil
+	}
+
+	data, err := os.ReadFile(metaPath)
+	if err != nil {
+		return nil
+	}
+
+	var have multiResumeMeta
+	if err := json.Unmarshal(data, &have); err != nil {
+		return nil
+	}
+
+	if have.URL != want.URL || have.Size != want.Size {
+		return nil
+	}
+	if want.ETag != "" && have.ETag != want.ETag {
+		return nil
+	}
+
+	return have.Completed
+}
+
+// partitionJobs splits jobs into the ones already recorded as completed (by
+// exact byte-range match) and the ones still pending, along with the total
+// size of the completed ones so the progress bar can be pre-credited.
+func partitionJobs(jobs []rangeJob, completed []rangeSpan) (pending []rangeJob, done []rangeSpan, completedBytes int64) {
+	completedSet := make(map[rangeSpan]bool, len(completed))
+	for _, c := range completed {
+		completedSet[c] = true
+	}
+	for _, job := range jobs {
+		span := rangeSpan{Start: job.start, End: job.end}
+		if completedSet[span] {
+			done = append(done, span)
+			completedBytes += job.end - job.start + 1
+			continue
+		}
+		pending = append(pending, job)
+	}
+	return pending, done, completedBytes
+}
+
+// multiResumeState tracks which ranges of a DownloadMulti have landed and
+// persists that list to disk as each one completes, so an interrupted run
+// can skip the work it already did instead of restarting from zero.
+type multiResumeState struct {
+	mu   sync.Mutex
+	meta multiResumeMeta
+	path string
+}
+
+func (s *multiResumeState) markCompleted(job rangeJob) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.meta.Completed = append(s.meta.Completed, rangeSpan{Start: job.start, End: job.end})
+	if data, err := json.Marshal(s.meta); err == nil {
+		os.WriteFile(s.path, data, 0644)
+	}
+}
+
+// DownloadMulti splits a snapshot into byte ranges and fetches them
+// concurrently across one or more mirrors that were confirmed to serve the
+// same content. It falls back to the single-stream Download when the
+// mirrors don't support ranged requests or disagree on size/ETag. Like
+// Download, it stages into a ".part" file and only renames it into place
+// once every range has landed, so an interrupted run never leaves a
+// corrupt, partially-written file under the final snapshot name. A
+// ".part.meta" sidecar records which ranges have already landed, so
+// rerunning the same command after an interruption resumes instead of
+// starting over.
+func (m *Manager) DownloadMulti(ctx context.Context, mirrors []provider.ProviderInfo, destDir string, opts MultiOpts) (*DownloadResult, error) {
+	if len(mirrors) == 0 {
+		return nil, fmt.Errorf("no mirrors provided")
+	}
+	if opts.Parts <= 0 {
+		opts.Parts = 1
+	}
+	if opts.PerConnection <= 0 {
+		opts.PerConnection = 1
+	}
+
+	primary := mirrors[0]
+	if opts.Parts <= 1 || !mirrorsAgree(mirrors) {
+		return m.Download(ctx, primary.URL, destDir, DefaultOptions())
+	}
+
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create destination directory: %w", err)
+	}
+
+	fileName := filepath.Base(primary.URL)
+	destPath := filepath.Join(destDir, fileName)
+	partPath := destPath + partSuffix
+	metaPath := partPath + metaSuffix
+
+	meta := multiResumeMeta{
+		URL:  primary.URL,
+		ETag: primary.ETag,
+		Size: primary.Size,
+	}
+
+	var jobs []rangeJob
+	if len(opts.PartHashes) > 0 {
+		jobs = jobsFromPartHashes(opts.PartHashes)
+	} else {
+		jobs = splitRanges(primary.Size, opts.Parts)
+	}
+
+	completed := loadMultiResume(partPath, metaPath, meta)
+	pending, done, completedBytes := partitionJobs(jobs, completed)
+	meta.Completed = done
+	if completedBytes == 0 {
+		os.Remove(partPath)
+		os.Remove(metaPath)
+	}
+
+	if data, err := json.Marshal(meta); err == nil {
+		os.WriteFile(metaPath, data, 0644)
+	}
+
+	flags := os.O_CREATE | os.O_RDWR
+	if completedBytes == 0 {
+		flags |= os.O_TRUNC
+	}
+
+	file, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file: %w", err)
+	}
+	defer file.Close()
+	if err := file.Truncate(primary.Size); err != nil {
+		return nil, fmt.Errorf("failed to preallocate file: %w", err)
+	}
+
+	resumeState := &multiResumeState{meta: meta, path: metaPath}
+	queue := newJobQueue(pending)
+
+	bar := progressbar.NewOptions64(
+		primary.Size,
+		progressbar.OptionSetDescription("Downloading"),
+		progressbar.OptionShowBytes(true),
+		progressbar.OptionSetWidth(15),
+		progressbar.OptionThrottle(65*time.Millisecond),
+		progressbar.OptionShowCount(),
+		progressbar.OptionOnCompletion(func() {
+			fmt.Println()
+		}),
+		progressbar.OptionUseIECUnits(false),
+	)
+	if completedBytes > 0 {
+		bar.Add64(completedBytes)
+	}
+
+	workerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Cap how many times a single range gets retried against the pool of
+	// mirrors before giving up on it entirely, so a range that's broken on
+	// every mirror (a stale/403'd byte range, say) surfaces a real error
+	// instead of the workers spinning on it forever.
+	maxJobAttempts := (m.policy.MaxRetries + 1) * len(mirrors)
+
+	outstanding := int32(queue.len())
+	var wg sync.WaitGroup
+	var failMu sync.Mutex
+	var jobErr error
+
+	for _, mirror := range mirrors {
+		for c := 0; c < opts.PerConnection; c++ {
+			wg.Add(1)
+			go func(mirror provider.ProviderInfo) {
+				defer wg.Done()
+				for {
+					job, ok := queue.pop()
+					if !ok {
+						return
+					}
+					if err := m.downloadRange(workerCtx, mirror.URL, file, bar, job); err != nil {
+						if workerCtx.Err() != nil {
+							return
+						}
+						job.attempts++
+						if job.attempts >= maxJobAttempts {
+							failMu.Lock()
+							if jobErr == nil {
+								jobErr = fmt.Errorf("range [%d-%d] failed after %d attempts across %d mirror(s): %w", job.start, job.end, job.attempts, len(mirrors), err)
+							}
+							failMu.Unlock()
+							// A range that's exhausted every mirror dooms the
+							// whole download; stop the rest of the workers
+							// immediately instead of waiting for them to
+							// finish the other ranges first.
+							atomic.AddInt32(&outstanding, -1)
+							cancel()
+							continue
+						}
+						queue.push(job)
+						continue
+					}
+					resumeState.markCompleted(job)
+					if atomic.AddInt32(&outstanding, -1) == 0 {
+						cancel()
+					}
+				}
+			}(mirror)
+		}
+	}
+
+	wg.Wait()
+
+	if jobErr != nil {
+		return nil, fmt.Errorf("multi-part download failed: %w", jobErr)
+	}
+	if outstanding > 0 {
+		return nil, fmt.Errorf("multi-part download failed: %d of %d parts incomplete", outstanding, queue.total)
+	}
+
+	if err := file.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finalize file: %w", err)
+	}
+
+	if err := os.Rename(partPath, destPath); err != nil {
+		return nil, fmt.Errorf("failed to finalize download: %w", err)
+	}
+	os.Remove(metaPath)
+
+	return &DownloadResult{
+		Path: destPath,
+		Size: primary.Size,
+	}, nil
+}
+
+// mirrorsAgree reports whether all mirrors advertise range support and
+// appear to serve identical content (same size, and matching ETag when
+// present).
+func mirrorsAgree(mirrors []provider.ProviderInfo) bool {
+	first := mirrors[0]
+	if !first.AcceptRanges || first.Size <= 0 {
+		return false
+	}
+	for _, mir := range mirrors[1:] {
+		if !mir.AcceptRanges || mir.Size != first.Size {
+			return false
+		}
+		if first.ETag != "" && mir.ETag != first.ETag {
+			return false
+		}
+	}
+	return true
+}
+
+type rangeJob struct {
+	start    int64
+	end      int64  // inclusive
+	attempts int    // number of failed attempts at this range so far, across all mirrors
+	sha256   string // expected digest of this range, when verifying per-part
+}
+
+// splitRanges divides [0, size) into up to n contiguous, inclusive byte ranges.
+func splitRanges(size int64, n int) []rangeJob {
+	if n < 1 {
+		n = 1
+	}
+	chunkSize := size / int64(n)
+	if chunkSize == 0 {
+		chunkSize = size
+		n = 1
+	}
+
+	jobs := make([]rangeJob, 0, n)
+	var offset int64
+	for i := 0; i < n; i++ {
+		end := offset + chunkSize - 1
+		if i == n-1 || end >= size-1 {
+			end = size - 1
+		}
+		jobs = append(jobs, rangeJob{start: offset, end: end})
+		offset = end + 1
+		if offset >= size {
+			break
+		}
+	}
+	return jobs
+}
+
+// jobsFromPartHashes builds one rangeJob per PartHash, carrying its
+// expected digest along so downloadRange can verify the range as it lands.
+func jobsFromPartHashes(parts []integrity.PartHash) []rangeJob {
+	jobs := make([]rangeJob, 0, len(parts))
+	for _, part := range parts {
+		jobs = append(jobs, rangeJob{
+			start:  part.Offset,
+			end:    part.Offset + part.Size - 1,
+			sha256: part.SHA256,
+		})
+	}
+	return jobs
+}
+
+// jobQueue is a simple thread-safe FIFO that also supports pushing a job
+// back onto the queue when a mirror fails to serve it, so another worker
+// can retry it against a different mirror.
+type jobQueue struct {
+	mu    sync.Mutex
+	items []rangeJob
+	total int
+}
+
+func newJobQueue(jobs []rangeJob) *jobQueue {
+	return &jobQueue{items: jobs, total: len(jobs)}
+}
+
+func (q *jobQueue) pop() (rangeJob, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) == 0 {
+		return rangeJob{}, false
+	}
+	job := q.items[0]
+	q.items = q.items[1:]
+	return job, true
+}
+
+func (q *jobQueue) push(job rangeJob) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.items = append(q.items, job)
+}
+
+func (q *jobQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// offsetWriter writes sequential bytes into a file starting at a fixed
+// offset via WriteAt, advancing a shared progress bar as it goes. written
+// tracks how many of those bytes this writer has credited to the bar, so a
+// caller that ends up discarding the write (e.g. retrying the same range
+// against a different mirror) can undo exactly that credit.
+type offsetWriter struct {
+	file    *os.File
+	bar     *progressbar.ProgressBar
+	off     int64
+	written int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.file.WriteAt(p, w.off)
+	w.off += int64(n)
+	w.written += int64(n)
+	if n > 0 {
+		w.bar.Add(n)
+	}
+	return n, err
+}
+
+func (m *Manager) downloadRange(ctx context.Context, url string, file *os.File, bar *progressbar.ProgressBar, job rangeJob) error {
+	w := &offsetWriter{file: file, bar: bar, off: job.start}
+	err := m.copyRange(ctx, url, w, job.end)
+	if err == nil && job.sha256 != "" {
+		err = integrity.VerifyPart(file, integrity.PartHash{
+			Offset: job.start,
+			Size:   job.end - job.start + 1,
+			SHA256: job.sha256,
+		})
+	}
+	if err != nil {
+		// The job will be requeued and re-fetched from job.start, so undo
+		// the bar credit for whatever this attempt already wrote — it
+		// otherwise double-counts those bytes once the retry succeeds.
+		if w.written > 0 {
+			bar.Add(-int(w.written))
+		}
+		return err
+	}
+	return nil
+}
+
+// copyRange fetches bytes [w.off, end] from url into w, retrying a dropped
+// mid-stream connection by resuming from the last byte actually written to
+// w instead of re-fetching the whole range, up to m.policy.MaxRetries times.
+func (m *Manager) copyRange(ctx context.Context, url string, w *offsetWriter, end int64) error {
+	var lastErr error
+	for attempt := 0; attempt <= m.policy.MaxRetries; attempt++ {
+		if attempt > 0 {
+			if err := retry.Sleep(ctx, retry.Backoff(m.policy, attempt)); err != nil {
+				return err
+			}
+		}
+		if w.off > end {
+			return nil
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", w.off, end))
+
+		resp, err := m.client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if resp.StatusCode != http.StatusPartialContent {
+			resp.Body.Close()
+			return fmt.Errorf("mirror returned unexpected status %d for range request", resp.StatusCode)
+		}
+
+		_, copyErr := io.Copy(w, resp.Body)
+		resp.Body.Close()
+		if copyErr == nil {
+			return nil
+		}
+		if !retry.IsRetryableError(copyErr) {
+			return copyErr
+		}
+		lastErr = copyErr
+	}
+	return fmt.Errorf("exceeded %d retries: %w", m.policy.MaxRetries, lastErr)
+}
@@ -0,0 +1,247 @@
+package downloader
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/21state/celestia-snapshot-finder/internal/provider"
+)
+
+func TestSplitRanges(t *testing.T) {
+	tests := []struct {
+		name string
+		size int64
+		n    int
+	}{
+		{"even split", 100, 4},
+		{"uneven split", 101, 4},
+		{"more parts than bytes", 3, 8},
+		{"single part", 100, 1},
+		{"zero parts requested", 100, 0},
+		{"negative parts requested", 100, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs := splitRanges(tt.size, tt.n)
+			if len(jobs) == 0 {
+				t.Fatalf("splitRanges(%d, %d) returned no jobs", tt.size, tt.n)
+			}
+
+			var next int64
+			for i, job := range jobs {
+				if job.start != next {
+					t.Fatalf("job %d starts at %d, want %d (gap or overlap)", i, job.start, next)
+				}
+				if job.end < job.start {
+					t.Fatalf("job %d has end %d before start %d", i, job.end, job.start)
+				}
+				next = job.end + 1
+			}
+			if next != tt.size {
+				t.Fatalf("ranges cover %d bytes, want %d", next, tt.size)
+			}
+		})
+	}
+}
+
+func TestResumeOffset(t *testing.T) {
+	dir := t.TempDir()
+	partPath := filepath.Join(dir, "file.part")
+	metaPath := partPath + metaSuffix
+
+	want := resumeMeta{URL: "https://example.com/file", ETag: "etag-1", Size: 1024}
+
+	t.Run("missing part file", func(t *testing.T) {
+		if got := resumeOffset(partPath, metaPath, want); got != 0 {
+			t.Fatalf("resumeOffset() = %d, want 0", got)
+		}
+	})
+
+	if err := os.WriteFile(partPath, make([]byte, 512), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("missing meta file", func(t *testing.T) {
+		if got := resumeOffset(partPath, metaPath, want); got != 0 {
+			t.Fatalf("resumeOffset() = %d, want 0", got)
+		}
+	})
+
+	writeMeta := func(m resumeMeta) {
+		data, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(metaPath, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("matching meta resumes", func(t *testing.T) {
+		writeMeta(want)
+		if got := resumeOffset(partPath, metaPath, want); got != 512 {
+			t.Fatalf("resumeOffset() = %d, want 512", got)
+		}
+	})
+
+	t.Run("url mismatch", func(t *testing.T) {
+		mismatch := want
+		mismatch.URL = "https://example.com/other"
+		writeMeta(mismatch)
+		if got := resumeOffset(partPath, metaPath, want); got != 0 {
+			t.Fatalf("resumeOffset() = %d, want 0", got)
+		}
+	})
+
+	t.Run("size mismatch", func(t *testing.T) {
+		mismatch := want
+		mismatch.Size = 2048
+		writeMeta(mismatch)
+		if got := resumeOffset(partPath, metaPath, want); got != 0 {
+			t.Fatalf("resumeOffset() = %d, want 0", got)
+		}
+	})
+
+	t.Run("etag mismatch", func(t *testing.T) {
+		mismatch := want
+		mismatch.ETag = "etag-2"
+		writeMeta(mismatch)
+		if got := resumeOffset(partPath, metaPath, want); got != 0 {
+			t.Fatalf("resumeOffset() = %d, want 0", got)
+		}
+	})
+
+	t.Run("empty part file never resumes", func(t *testing.T) {
+		writeMeta(want)
+		if err := os.WriteFile(partPath, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if got := resumeOffset(partPath, metaPath, want); got != 0 {
+			t.Fatalf("resumeOffset() = %d, want 0", got)
+		}
+	})
+}
+
+func TestParseContentRangeTotal(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   int64
+		wantOk bool
+	}{
+		{"well formed", "bytes 0-99/100", 100, true},
+		{"mid-range", "bytes 512-1023/2048", 2048, true},
+		{"unit missing", "0-99/100", 0, false},
+		{"wildcard total", "bytes 0-99/*", 0, false},
+		{"empty", "", 0, false},
+		{"garbage", "not a content range", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseContentRangeTotal(tt.header)
+			if ok != tt.wantOk || got != tt.want {
+				t.Fatalf("parseContentRangeTotal(%q) = (%d, %v), want (%d, %v)", tt.header, got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestMirrorsAgree(t *testing.T) {
+	tests := []struct {
+		name    string
+		mirrors []provider.ProviderInfo
+		want    bool
+	}{
+		{
+			name: "agree",
+			mirrors: []provider.ProviderInfo{
+				{Name: "a", Size: 100, AcceptRanges: true, ETag: "etag-1"},
+				{Name: "b", Size: 100, AcceptRanges: true, ETag: "etag-1"},
+			},
+			want: true,
+		},
+		{
+			name: "size mismatch",
+			mirrors: []provider.ProviderInfo{
+				{Name: "a", Size: 100, AcceptRanges: true},
+				{Name: "b", Size: 200, AcceptRanges: true},
+			},
+			want: false,
+		},
+		{
+			name: "etag mismatch",
+			mirrors: []provider.ProviderInfo{
+				{Name: "a", Size: 100, AcceptRanges: true, ETag: "etag-1"},
+				{Name: "b", Size: 100, AcceptRanges: true, ETag: "etag-2"},
+			},
+			want: false,
+		},
+		{
+			name: "primary doesn't accept ranges",
+			mirrors: []provider.ProviderInfo{
+				{Name: "a", Size: 100, AcceptRanges: false},
+				{Name: "b", Size: 100, AcceptRanges: true},
+			},
+			want: false,
+		},
+		{
+			name: "secondary doesn't accept ranges",
+			mirrors: []provider.ProviderInfo{
+				{Name: "a", Size: 100, AcceptRanges: true},
+				{Name: "b", Size: 100, AcceptRanges: false},
+			},
+			want: false,
+		},
+		{
+			name: "missing etag is ignored",
+			mirrors: []provider.ProviderInfo{
+				{Name: "a", Size: 100, AcceptRanges: true},
+				{Name: "b", Size: 100, AcceptRanges: true, ETag: "etag-1"},
+			},
+			want: true,
+		},
+		{
+			name: "single mirror",
+			mirrors: []provider.ProviderInfo{
+				{Name: "a", Size: 100, AcceptRanges: true},
+			},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mirrorsAgree(tt.mirrors); got != tt.want {
+				t.Fatalf("mirrorsAgree() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPartitionJobs(t *testing.T) {
+	jobs := []rangeJob{
+		{start: 0, end: 9},
+		{start: 10, end: 19},
+		{start: 20, end: 29},
+	}
+	completed := []rangeSpan{
+		{Start: 0, End: 9},
+		{Start: 20, End: 29},
+	}
+
+	pending, done, completedBytes := partitionJobs(jobs, completed)
+
+	if len(pending) != 1 || pending[0].start != 10 || pending[0].end != 19 {
+		t.Fatalf("pending = %+v, want only the [10-19] range", pending)
+	}
+	if len(done) != 2 {
+		t.Fatalf("done = %+v, want 2 spans", done)
+	}
+	if completedBytes != 20 {
+		t.Fatalf("completedBytes = %d, want 20", completedBytes)
+	}
+}
@@ -1,28 +1,30 @@
 package provider
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/21state/celestia-snapshot-finder/internal/config"
+	"github.com/21state/celestia-snapshot-finder/internal/retry"
 )
 
 type DebugLogger func(format string, a ...interface{})
 
 type Manager struct {
 	providers []config.Provider
-	client    *http.Client
+	client    *retry.Client
 	debugLog  DebugLogger
 }
 
-func NewManager(providers []config.Provider, debugLog DebugLogger) *Manager {
+func NewManager(providers []config.Provider, debugLog DebugLogger, retryPolicy retry.Policy, injector retry.FailureInjector) *Manager {
 	return &Manager{
 		providers: providers,
-		client: &http.Client{
+		client: retry.NewClient(&http.Client{
 			Timeout: 3 * time.Second,
-		},
+		}, retryPolicy, injector, debugLog),
 		debugLog: debugLog,
 	}
 }
@@ -46,11 +48,15 @@ func (m *Manager) FilterProviders(nodeType, snapshotType, chainID string) []Prov
 	return result
 }
 
-func (m *Manager) CheckHealth(providers []ProviderInfo) []ProviderInfo {
+func (m *Manager) CheckHealth(ctx context.Context, providers []ProviderInfo) []ProviderInfo {
 	var healthy []ProviderInfo
 	for _, p := range providers {
+		if ctx.Err() != nil {
+			m.debugLog("Health checks cancelled: %v", ctx.Err())
+			break
+		}
 		m.debugLog("Checking health for snapshot %s (%s)", p.Name, p.URL)
-		isHealthy, err := m.isHealthy(p.URL, &p)
+		isHealthy, err := m.isHealthy(ctx, p.URL, &p)
 		if !isHealthy {
 			m.debugLog("Snapshot %s health check failed: %v", p.Name, err)
 			continue
@@ -61,9 +67,13 @@ func (m *Manager) CheckHealth(providers []ProviderInfo) []ProviderInfo {
 	return healthy
 }
 
-func (m *Manager) isHealthy(url string, info *ProviderInfo) (bool, error) {
+func (m *Manager) isHealthy(ctx context.Context, url string, info *ProviderInfo) (bool, error) {
 	start := time.Now()
-	resp, err := m.client.Head(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to build request: %v", err)
+	}
+	resp, err := m.client.Do(req)
 	if err != nil {
 		return false, fmt.Errorf("connection failed: %v", err)
 	}
@@ -96,12 +106,15 @@ func (m *Manager) isHealthy(url string, info *ProviderInfo) (bool, error) {
 	m.debugLog("  Content-Type: %s", contentType)
 
 	acceptRanges := resp.Header.Get("Accept-Ranges")
-	if acceptRanges == "bytes" {
+	info.AcceptRanges = acceptRanges == "bytes"
+	if info.AcceptRanges {
 		m.debugLog("  Resume capability: supported (Accept-Ranges: bytes)")
 	} else {
 		m.debugLog("  Resume capability: not supported")
 	}
 
+	info.ETag = resp.Header.Get("ETag")
+
 	return true, nil
 }
 
@@ -112,6 +125,8 @@ type ProviderInfo struct {
 	Speed        float64
 	Size         int64
 	DownloadTime float64
+	AcceptRanges bool
+	ETag         string
 }
 
 func (p ProviderInfo) String() string {
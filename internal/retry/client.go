@@ -0,0 +1,236 @@
+// Package retry wraps an *http.Client with exponential backoff and
+// injectable failure simulation, shared by downloader, speedtest, and
+// provider so their outbound requests behave the same way under flaky
+// networks.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Policy bounds how many times a request is retried and how long to wait
+// between attempts.
+type Policy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+// DefaultPolicy is used wherever a caller doesn't need different limits.
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxRetries: 3,
+		BaseDelay:  500 * time.Millisecond,
+		MaxDelay:   10 * time.Second,
+	}
+}
+
+// FailureInjector lets tests and operators exercise the retry path against
+// real mirrors by forcing a fraction of requests to fail or stall before
+// they're actually sent.
+type FailureInjector interface {
+	// Inject is consulted before every attempt. When fail is true the
+	// attempt is treated as a simulated network failure and goes through
+	// the normal retry policy. stallFor, if non-zero, is slept before the
+	// real request is made.
+	Inject(req *http.Request) (fail bool, stallFor time.Duration)
+}
+
+// RateInjector fails (and optionally stalls) an approximate percentage of
+// requests, driven by FailRate/StallRate in [0, 1].
+type RateInjector struct {
+	FailRate  float64
+	StallRate float64
+	StallFor  time.Duration
+	Rand      *rand.Rand
+}
+
+func (r *RateInjector) Inject(req *http.Request) (bool, time.Duration) {
+	rng := r.Rand
+	if rng == nil {
+		rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	fail := r.FailRate > 0 && rng.Float64() < r.FailRate
+
+	var stall time.Duration
+	if r.StallRate > 0 && rng.Float64() < r.StallRate {
+		stall = r.StallFor
+	}
+
+	return fail, stall
+}
+
+var errSimulatedFailure = errors.New("simulated failure injected")
+
+// Doer is satisfied by *http.Client.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Client retries requests made through a Doer according to Policy,
+// honoring Retry-After on 429/503 responses and optionally running every
+// attempt through a FailureInjector first.
+type Client struct {
+	inner    Doer
+	policy   Policy
+	injector FailureInjector
+	debugLog func(format string, a ...interface{})
+}
+
+func NewClient(inner Doer, policy Policy, injector FailureInjector, debugLog func(format string, a ...interface{})) *Client {
+	if debugLog == nil {
+		debugLog = func(string, ...interface{}) {}
+	}
+	return &Client{
+		inner:    inner,
+		policy:   policy,
+		injector: injector,
+		debugLog: debugLog,
+	}
+}
+
+// Do behaves like (*http.Client).Do but retries retryable failures with
+// exponential backoff.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	var lastErr error
+	var overrideDelay time.Duration
+
+	for attempt := 0; attempt <= c.policy.MaxRetries; attempt++ {
+		if attempt > 0 {
+			delay := overrideDelay
+			if delay == 0 {
+				delay = backoff(c.policy, attempt)
+			}
+			overrideDelay = 0
+			c.debugLog("Retrying %s %s (attempt %d/%d) in %v: %v", req.Method, req.URL, attempt, c.policy.MaxRetries, delay, lastErr)
+			if err := sleepCtx(req.Context(), delay); err != nil {
+				return nil, err
+			}
+		}
+
+		if c.injector != nil {
+			fail, stall := c.injector.Inject(req)
+			if stall > 0 {
+				if err := sleepCtx(req.Context(), stall); err != nil {
+					return nil, err
+				}
+			}
+			if fail {
+				lastErr = errSimulatedFailure
+				continue
+			}
+		}
+
+		resp, err := c.inner.Do(req)
+		if err != nil {
+			if !isRetryableErr(err) {
+				return nil, err
+			}
+			lastErr = err
+			continue
+		}
+
+		if !isRetryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+
+		lastErr = fmt.Errorf("retryable status %d", resp.StatusCode)
+		if d, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			overrideDelay = d
+		}
+		resp.Body.Close()
+	}
+
+	return nil, fmt.Errorf("exceeded %d retries: %w", c.policy.MaxRetries, lastErr)
+}
+
+// Backoff computes the delay before retry attempt (1-indexed) under p.
+// Exported so callers that retry a mid-stream body transfer themselves
+// (outside of Client.Do's request/response retry loop) can reuse the same
+// backoff/jitter behavior.
+func Backoff(p Policy, attempt int) time.Duration {
+	return backoff(p, attempt)
+}
+
+// Sleep waits for d or until ctx is canceled, whichever comes first.
+func Sleep(ctx context.Context, d time.Duration) error {
+	return sleepCtx(ctx, d)
+}
+
+// IsRetryableError reports whether err represents a transient failure worth
+// retrying, such as a dropped mid-stream connection.
+func IsRetryableError(err error) bool {
+	return isRetryableErr(err)
+}
+
+func backoff(p Policy, attempt int) time.Duration {
+	d := p.BaseDelay * time.Duration(int64(1)<<uint(attempt-1))
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	// Full jitter: spread retries out so a thundering herd of clients
+	// doesn't retry in lockstep.
+	return time.Duration(rand.Int63n(int64(d)))
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func isRetryableStatus(code int) bool {
+	if code >= 500 {
+		return true
+	}
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	}
+	return false
+}
+
+func isRetryableErr(err error) bool {
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		d := time.Until(when)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
@@ -0,0 +1,228 @@
+package retry
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBackoffBounds(t *testing.T) {
+	policy := Policy{MaxRetries: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	for attempt := 1; attempt <= 10; attempt++ {
+		upper := policy.BaseDelay * time.Duration(int64(1)<<uint(attempt-1))
+		if policy.MaxDelay > 0 && upper > policy.MaxDelay {
+			upper = policy.MaxDelay
+		}
+		for i := 0; i < 20; i++ {
+			d := backoff(policy, attempt)
+			if d < 0 || d >= upper {
+				t.Fatalf("backoff(attempt=%d) = %v, want in [0, %v)", attempt, d, upper)
+			}
+		}
+	}
+}
+
+func TestBackoffZeroBaseDelay(t *testing.T) {
+	policy := Policy{MaxRetries: 3, BaseDelay: 0, MaxDelay: time.Second}
+	if d := backoff(policy, 1); d != 0 {
+		t.Fatalf("backoff() = %v, want 0", d)
+	}
+}
+
+type fakeNetErr struct{}
+
+func (fakeNetErr) Error() string   { return "fake net error" }
+func (fakeNetErr) Timeout() bool   { return true }
+func (fakeNetErr) Temporary() bool { return true }
+
+func TestIsRetryableErr(t *testing.T) {
+	var _ net.Error = fakeNetErr{}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"unexpected eof", io.ErrUnexpectedEOF, true},
+		{"wrapped unexpected eof", fmt.Errorf("copy: %w", io.ErrUnexpectedEOF), true},
+		{"net error", fakeNetErr{}, true},
+		{"generic error", errors.New("boom"), false},
+		{"nil error", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryableErr(tt.err); got != tt.want {
+				t.Fatalf("isRetryableErr(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		want   time.Duration
+		wantOk bool
+	}{
+		{"seconds", "5", 5 * time.Second, true},
+		{"zero seconds", "0", 0, true},
+		{"negative seconds", "-5", 0, false},
+		{"empty", "", 0, false},
+		{"garbage", "not-a-date", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseRetryAfter(tt.value)
+			if ok != tt.wantOk {
+				t.Fatalf("parseRetryAfter(%q) ok = %v, want %v", tt.value, ok, tt.wantOk)
+			}
+			if ok && got != tt.want {
+				t.Fatalf("parseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("http date in the future", func(t *testing.T) {
+		when := time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat)
+		got, ok := parseRetryAfter(when)
+		if !ok {
+			t.Fatalf("parseRetryAfter(%q) ok = false, want true", when)
+		}
+		if got <= 0 || got > 10*time.Second {
+			t.Fatalf("parseRetryAfter(%q) = %v, want in (0, 10s]", when, got)
+		}
+	})
+}
+
+func TestRateInjector(t *testing.T) {
+	t.Run("always fails", func(t *testing.T) {
+		inj := &RateInjector{FailRate: 1, Rand: rand.New(rand.NewSource(1))}
+		req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+		fail, stall := inj.Inject(req)
+		if !fail {
+			t.Fatal("Inject() fail = false, want true")
+		}
+		if stall != 0 {
+			t.Fatalf("Inject() stall = %v, want 0", stall)
+		}
+	})
+
+	t.Run("never fails", func(t *testing.T) {
+		inj := &RateInjector{FailRate: 0, Rand: rand.New(rand.NewSource(1))}
+		req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+		if fail, _ := inj.Inject(req); fail {
+			t.Fatal("Inject() fail = true, want false")
+		}
+	})
+
+	t.Run("always stalls", func(t *testing.T) {
+		inj := &RateInjector{StallRate: 1, StallFor: 50 * time.Millisecond, Rand: rand.New(rand.NewSource(1))}
+		req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+		_, stall := inj.Inject(req)
+		if stall != 50*time.Millisecond {
+			t.Fatalf("Inject() stall = %v, want 50ms", stall)
+		}
+	})
+}
+
+// fakeDoer lets tests drive Client.Do against canned responses/errors
+// without a real network round trip.
+type fakeDoer struct {
+	responses []fakeResponse
+	calls     int
+}
+
+type fakeResponse struct {
+	resp *http.Response
+	err  error
+}
+
+func (f *fakeDoer) Do(req *http.Request) (*http.Response, error) {
+	r := f.responses[f.calls]
+	f.calls++
+	return r.resp, r.err
+}
+
+func newResp(status int) *http.Response {
+	return &http.Response{StatusCode: status, Body: io.NopCloser(http.NoBody)}
+}
+
+func TestClientDoRetriesThenSucceeds(t *testing.T) {
+	doer := &fakeDoer{responses: []fakeResponse{
+		{err: io.ErrUnexpectedEOF},
+		{resp: newResp(http.StatusServiceUnavailable)},
+		{resp: newResp(http.StatusOK)},
+	}}
+
+	client := NewClient(doer, Policy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}, nil, nil)
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Do() error = %v, want nil", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Do() status = %d, want 200", resp.StatusCode)
+	}
+	if doer.calls != 3 {
+		t.Fatalf("Do() made %d calls, want 3", doer.calls)
+	}
+}
+
+func TestClientDoExhaustsRetries(t *testing.T) {
+	doer := &fakeDoer{responses: []fakeResponse{
+		{err: io.ErrUnexpectedEOF},
+		{err: io.ErrUnexpectedEOF},
+	}}
+
+	client := NewClient(doer, Policy{MaxRetries: 1, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}, nil, nil)
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+
+	if _, err := client.Do(req); err == nil {
+		t.Fatal("Do() error = nil, want non-nil")
+	}
+	if doer.calls != 2 {
+		t.Fatalf("Do() made %d calls, want 2", doer.calls)
+	}
+}
+
+func TestClientDoNonRetryableErrorStopsImmediately(t *testing.T) {
+	doer := &fakeDoer{responses: []fakeResponse{
+		{err: errors.New("boom")},
+	}}
+
+	client := NewClient(doer, Policy{MaxRetries: 3, BaseDelay: time.Millisecond}, nil, nil)
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+
+	if _, err := client.Do(req); err == nil {
+		t.Fatal("Do() error = nil, want non-nil")
+	}
+	if doer.calls != 1 {
+		t.Fatalf("Do() made %d calls, want 1 (non-retryable error should not retry)", doer.calls)
+	}
+}
+
+func TestClientDoWithFailureInjector(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	inj := &RateInjector{FailRate: 1, Rand: rand.New(rand.NewSource(1))}
+	client := NewClient(http.DefaultClient, Policy{MaxRetries: 2, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}, inj, nil)
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+
+	if _, err := client.Do(req); err == nil {
+		t.Fatal("Do() error = nil, want non-nil (injector should fail every attempt)")
+	}
+}
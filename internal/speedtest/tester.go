@@ -1,12 +1,14 @@
 package speedtest
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"sync"
 	"time"
 
 	"github.com/21state/celestia-snapshot-finder/internal/provider"
+	"github.com/21state/celestia-snapshot-finder/internal/retry"
 )
 
 const (
@@ -15,20 +17,20 @@ const (
 )
 
 type SpeedTester struct {
-	client   *http.Client
+	client   *retry.Client
 	debugLog provider.DebugLogger
 }
 
-func NewSpeedTester(debugLog provider.DebugLogger) *SpeedTester {
+func NewSpeedTester(debugLog provider.DebugLogger, retryPolicy retry.Policy, injector retry.FailureInjector) *SpeedTester {
 	return &SpeedTester{
-		client: &http.Client{
+		client: retry.NewClient(&http.Client{
 			Timeout: testDuration + 5*time.Second,
-		},
+		}, retryPolicy, injector, debugLog),
 		debugLog: debugLog,
 	}
 }
 
-func (st *SpeedTester) TestProviders(providers []provider.ProviderInfo) []provider.ProviderInfo {
+func (st *SpeedTester) TestProviders(ctx context.Context, providers []provider.ProviderInfo) []provider.ProviderInfo {
 	result := make([]provider.ProviderInfo, len(providers))
 	copy(result, providers)
 
@@ -39,7 +41,7 @@ func (st *SpeedTester) TestProviders(providers []provider.ProviderInfo) []provid
 		go func(idx int) {
 			defer wg.Done()
 			st.debugLog("Running speed test for provider %s", result[idx].Name)
-			speed := st.testSpeed(result[idx].URL)
+			speed := st.testSpeed(ctx, result[idx].URL)
 			result[idx].Speed = speed
 			
 			// Calculate download time
@@ -59,8 +61,13 @@ func (st *SpeedTester) TestProviders(providers []provider.ProviderInfo) []provid
 	return result
 }
 
-func (st *SpeedTester) testSpeed(url string) float64 {
-	resp, err := st.client.Get(url)
+func (st *SpeedTester) testSpeed(ctx context.Context, url string) float64 {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		st.debugLog("Speed test failed for URL %s: %v", url, err)
+		return 0
+	}
+	resp, err := st.client.Do(req)
 	if err != nil {
 		st.debugLog("Speed test failed for URL %s: %v", url, err)
 		return 0